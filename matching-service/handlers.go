@@ -21,25 +21,36 @@ func createMatchHandler(service *MatchingService) gin.HandlerFunc {
 			return
 		}
 
-		resultChan := service.ProcessMatchRequest(req)
+		events := service.ProcessMatchRequest(req)
 
-		select {
-		case result := <-resultChan:
-			if result.SessionID == "" {
-				c.JSON(http.StatusRequestTimeout, gin.H{
-					"status":  "timeout_or_cancelled",
-					"message": "No match found within the time limit.",
-				})
-			} else {
-				c.JSON(http.StatusOK, gin.H{
-					"status":  "success",
-					"message": "Match found!",
-					"data":    result,
-				})
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if event.Type == EventQueueUpdate {
+					// This long-poll route doesn't surface progress, only
+					// the eventual outcome; keep waiting for it.
+					continue
+				}
+				if event.Type == EventMatchFound {
+					c.JSON(http.StatusOK, gin.H{
+						"status":  "success",
+						"message": "Match found!",
+						"data":    event.Result,
+					})
+				} else {
+					c.JSON(http.StatusRequestTimeout, gin.H{
+						"status":  "timeout_or_cancelled",
+						"message": "No match found within the time limit.",
+					})
+				}
+				return
+			case <-c.Done():
+				log.Warn().Str("userId", req.UserID).Msg("Client disconnected before a result was sent.")
+				return
 			}
-		case <-c.Done():
-			log.Warn().Str("userId", req.UserID).Msg("Client disconnected before a result was sent.")
-			return
 		}
 	}
 }
@@ -4,25 +4,105 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+
+	"github.com/CS3219-AY2526Sem1/cs3219-ay2526s1-project-g30/matching-service/repo"
 )
 
+// startMetricsServer exposes /metrics on its own port so Prometheus can
+// scrape it independently of the API port. It's a no-op if METRICS_PORT
+// isn't set, since most local dev doesn't need a scraper running.
+func startMetricsServer() {
+	port := os.Getenv("METRICS_PORT")
+	if port == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	addr := fmt.Sprintf("0.0.0.0:%s", port)
+	go func() {
+		log.Info().Msgf("Metrics server listening on %s...", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Error().Err(err).Msg("Metrics server stopped")
+		}
+	}()
+}
+
+// newWaitingPool picks the pool backend based on POOL_BACKEND. "memory"
+// (the default) keeps everything in this process and is what local dev
+// without Redis running should use; "redis" shares the pool across
+// replicas via REDIS_ADDR.
+func newWaitingPool() WaitingPool {
+	if getEnv("POOL_BACKEND", "memory") != "redis" {
+		return NewMemoryWaitingPool()
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     getEnv("REDIS_ADDR", "localhost:6379"),
+		Password: getEnv("REDIS_PASSWORD", ""),
+	})
+	log.Info().Str("addr", client.Options().Addr).Msg("Using Redis-backed waiting pool")
+	return NewRedisWaitingPool(client)
+}
+
+// newMatcher picks the matching strategy based on MATCHER_STRATEGY.
+// "absolute" (the default) only ever pairs users in the same
+// difficulty+topic bucket who share a language; "relaxed" widens the
+// search with the searching user's wait time, tuned by
+// MatcherConfigFromEnv. ProcessMatchRequest runs that search once, as a
+// request arrives, and a request already waiting in the pool is not
+// searched for again, so the relaxed search only reaches past the exact
+// bucket when MATCH_EXACT_WINDOW_SECONDS is 0.
+func newMatcher() Matcher {
+	if getEnv("MATCHER_STRATEGY", "absolute") == "relaxed" {
+		return NewRelaxedMatcher(MatcherConfigFromEnv())
+	}
+	return &AbsoluteMatcher{}
+}
+
+// newRepo picks the history repo based on DATABASE_URL. Leaving it unset
+// (the default) falls back to a no-op repo so local dev without Postgres
+// running still works; if it's set but the connection fails, the service
+// still starts, just without history/stats persistence.
+func newRepo() repo.Repo {
+	databaseURL := getEnv("DATABASE_URL", "")
+	if databaseURL == "" {
+		return repo.NoopRepo{}
+	}
+
+	postgresRepo, err := repo.NewPostgresRepo(databaseURL)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to connect to match history database; continuing without persistence")
+		return repo.NoopRepo{}
+	}
+	log.Info().Msg("Connected to match history database")
+	return postgresRepo
+}
+
 func main() {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 
 	gin.SetMode(gin.ReleaseMode)
 
-	matcher := &AbsoluteMatcher{}
-	service := NewMatchingService(matcher)
+	service := NewMatchingService(newMatcher(), newWaitingPool(), newRepo())
+	startMetricsServer()
 
 	router := gin.Default()
 	router.POST("/api/v1/match", createMatchHandler(service))
+	router.GET("/api/v1/match/ws", createMatchWSHandler(service))
+	router.GET("/api/v1/match/history", createMatchHistoryHandler(service))
+	router.GET("/api/v1/match/stats", createMatchStatsHandler(service))
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,211 @@
+// matcher_relaxed.go
+
+package main
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MatcherConfig tunes how aggressively RelaxedMatcher widens its search as
+// a user waits longer, so the policy can be retuned with env vars instead
+// of a code change.
+type MatcherConfig struct {
+	ExactWindow    time.Duration // below this wait, only exact difficulty+topic+language match
+	AdjacentWindow time.Duration // below this wait, adjacent difficulty (same topic) is also considered
+	AnyTopicWindow time.Duration // below this wait, any topic within the same difficulty is also considered
+}
+
+// DefaultMatcherConfig mirrors the thresholds from the original request:
+// 10s exact, 10-20s adjacent difficulty, 20-30s any topic.
+func DefaultMatcherConfig() MatcherConfig {
+	return MatcherConfig{
+		ExactWindow:    10 * time.Second,
+		AdjacentWindow: 20 * time.Second,
+		AnyTopicWindow: 30 * time.Second,
+	}
+}
+
+// MatcherConfigFromEnv reads MATCH_EXACT_WINDOW_SECONDS,
+// MATCH_ADJACENT_WINDOW_SECONDS and MATCH_ANY_TOPIC_WINDOW_SECONDS,
+// falling back to DefaultMatcherConfig for whichever are unset or invalid.
+func MatcherConfigFromEnv() MatcherConfig {
+	cfg := DefaultMatcherConfig()
+	cfg.ExactWindow = envSeconds("MATCH_EXACT_WINDOW_SECONDS", cfg.ExactWindow)
+	cfg.AdjacentWindow = envSeconds("MATCH_ADJACENT_WINDOW_SECONDS", cfg.AdjacentWindow)
+	cfg.AnyTopicWindow = envSeconds("MATCH_ANY_TOPIC_WINDOW_SECONDS", cfg.AnyTopicWindow)
+	return cfg
+}
+
+func envSeconds(key string, fallback time.Duration) time.Duration {
+	raw, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+var difficultyOrder = map[string]int{"easy": 0, "medium": 1, "hard": 2}
+
+// adjacentDifficulties returns the difficulties one step away from d in
+// difficultyOrder (easy<->medium, medium<->hard), excluding d itself.
+func adjacentDifficulties(d string) []string {
+	rank, ok := difficultyOrder[strings.ToLower(strings.TrimSpace(d))]
+	if !ok {
+		return nil
+	}
+	var out []string
+	for other, otherRank := range difficultyOrder {
+		if otherRank == rank-1 || otherRank == rank+1 {
+			out = append(out, other)
+		}
+	}
+	return out
+}
+
+// RelaxedMatcher widens the candidate set as newUser's wait time grows,
+// instead of only ever considering its own exact difficulty+topic bucket.
+// It scores every candidate it examines (topic match > difficulty match >
+// language overlap > wait time) and keeps the best one.
+type RelaxedMatcher struct {
+	Config MatcherConfig
+}
+
+func NewRelaxedMatcher(cfg MatcherConfig) *RelaxedMatcher {
+	return &RelaxedMatcher{Config: cfg}
+}
+
+// scoredCandidate is a peeked (not popped) candidate along with the bucket
+// key it was found in and how it scored against newUser.
+type scoredCandidate struct {
+	user  *WaitingUser
+	key   string
+	score int
+	lang  string
+}
+
+// FindMatch scores every candidate across the widened search by peeking
+// each bucket, then pops only the single best one. An earlier version
+// popped every candidate in every widened bucket up front and requeued
+// all but the winner; on the Redis-backed pool that meant one widened
+// search could drain an entire difficulty tier out of the shared pool and
+// round-trip a Requeue for every loser, which defeats the point of moving
+// to Redis for horizontal scale in the first place.
+func (m *RelaxedMatcher) FindMatch(ctx context.Context, newUser *WaitingUser, pool WaitingPool) (*WaitingUser, string, error) {
+	keys, err := m.candidateKeys(ctx, newUser, pool, time.Since(newUser.EnqueuedAt))
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Only the last-resort search past AnyTopicWindow accepts a candidate
+	// with no language in common with newUser.
+	requireCommonLang := time.Since(newUser.EnqueuedAt) < m.Config.AnyTopicWindow
+
+	var candidates []scoredCandidate
+	for _, key := range keys {
+		peeked, err := pool.Peek(ctx, key)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, candidate := range peeked {
+			if _, found := findFirstCommonLang(newUser.Info.PreferredProgrammingLang, candidate.Info.PreferredProgrammingLang); requireCommonLang && !found {
+				continue
+			}
+			score, lang := m.score(newUser, candidate)
+			candidates = append(candidates, scoredCandidate{user: candidate, key: key, score: score, lang: lang})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	// Try candidates best-first. PopUser fails closed (nil, no error) if
+	// another search already popped this candidate between our peek and
+	// now; when that happens, just move on to the next-best rather than
+	// treating it as an error.
+	for _, c := range candidates {
+		popped, err := pool.PopUser(ctx, c.key, c.user.Info.UserID)
+		if err != nil {
+			return nil, "", err
+		}
+		if popped == nil {
+			continue
+		}
+		return popped, c.lang, nil
+	}
+
+	return nil, "", nil
+}
+
+// candidateKeys returns the bucket keys to search, widening with waited
+// per m.Config.
+func (m *RelaxedMatcher) candidateKeys(ctx context.Context, newUser *WaitingUser, pool WaitingPool, waited time.Duration) ([]string, error) {
+	exactKey := createMatchKey(newUser.Info.Difficulty, newUser.Info.Topic)
+
+	if waited < m.Config.ExactWindow {
+		return []string{exactKey}, nil
+	}
+
+	if waited < m.Config.AdjacentWindow {
+		keys := []string{exactKey}
+		for _, adjacent := range adjacentDifficulties(newUser.Info.Difficulty) {
+			keys = append(keys, createMatchKey(adjacent, newUser.Info.Topic))
+		}
+		return keys, nil
+	}
+
+	if waited < m.Config.AnyTopicWindow {
+		// Any topic, but still the same difficulty.
+		prefix := strings.ToLower(strings.TrimSpace(newUser.Info.Difficulty)) + "-"
+		return pool.KeysWithPrefix(ctx, prefix)
+	}
+
+	// Past AnyTopicWindow: truly last resort, every bucket regardless of
+	// difficulty or topic. score already falls back to newUser's own
+	// first preferred language when a candidate has no overlap with it.
+	return pool.KeysWithPrefix(ctx, "")
+}
+
+// score rates how good a candidate is for newUser: topic match outweighs
+// difficulty match, which outweighs language overlap, which outweighs how
+// long the candidate has already waited (a tiebreaker favouring fairness).
+// It also returns the language the match should use, falling back to
+// newUser's first preferred language when there is no overlap at all.
+func (m *RelaxedMatcher) score(newUser *WaitingUser, candidate *WaitingUser) (int, string) {
+	const (
+		topicWeight      = 100000
+		difficultyWeight = 10000
+		langWeight       = 1000
+	)
+
+	score := 0
+	if strings.EqualFold(candidate.Info.Topic, newUser.Info.Topic) {
+		score += topicWeight
+	}
+	if strings.EqualFold(candidate.Info.Difficulty, newUser.Info.Difficulty) {
+		score += difficultyWeight
+	}
+
+	lang, found := findFirstCommonLang(newUser.Info.PreferredProgrammingLang, candidate.Info.PreferredProgrammingLang)
+	if found {
+		score += langWeight
+	} else if len(newUser.Info.PreferredProgrammingLang) > 0 {
+		lang = newUser.Info.PreferredProgrammingLang[0]
+	}
+
+	// Capped below langWeight so waiting time only ever breaks ties.
+	waited := int(time.Since(candidate.EnqueuedAt).Seconds())
+	if waited >= langWeight {
+		waited = langWeight - 1
+	}
+	score += waited
+
+	return score, lang
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdjacentDifficulties(t *testing.T) {
+	cases := map[string][]string{
+		"easy":   {"medium"},
+		"hard":   {"medium"},
+		"Medium": {"easy", "hard"},
+		"expert": nil,
+	}
+	for input, want := range cases {
+		got := adjacentDifficulties(input)
+		if len(got) != len(want) {
+			t.Errorf("adjacentDifficulties(%q) = %v, want %v", input, got, want)
+			continue
+		}
+		for _, w := range want {
+			found := false
+			for _, g := range got {
+				if g == w {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("adjacentDifficulties(%q) = %v, missing %q", input, got, w)
+			}
+		}
+	}
+}
+
+func TestRelaxedMatcherScorePrefersTopicOverLanguage(t *testing.T) {
+	m := NewRelaxedMatcher(DefaultMatcherConfig())
+	newUser := &WaitingUser{Info: MatchRequest{Difficulty: "easy", Topic: "arrays", PreferredProgrammingLang: []string{"go"}}}
+
+	sameTopicNoLang := &WaitingUser{Info: MatchRequest{Difficulty: "easy", Topic: "arrays", PreferredProgrammingLang: []string{"rust"}}, EnqueuedAt: time.Now()}
+	otherTopicSameLang := &WaitingUser{Info: MatchRequest{Difficulty: "easy", Topic: "graphs", PreferredProgrammingLang: []string{"go"}}, EnqueuedAt: time.Now()}
+
+	scoreA, _ := m.score(newUser, sameTopicNoLang)
+	scoreB, _ := m.score(newUser, otherTopicSameLang)
+	if scoreA <= scoreB {
+		t.Fatalf("expected topic match to outweigh language match: scoreA=%d scoreB=%d", scoreA, scoreB)
+	}
+}
+
+// TestCandidateKeysRespectsAnyTopicWindow guards against a regression
+// where AnyTopicWindow was read from env but never actually checked:
+// candidateKeys widened straight from "adjacent difficulty" to "every
+// bucket regardless of difficulty or topic" the moment AdjacentWindow
+// elapsed, so no value of MATCH_ANY_TOPIC_WINDOW_SECONDS changed anything.
+func TestCandidateKeysRespectsAnyTopicWindow(t *testing.T) {
+	ctx := context.Background()
+	pool := NewMemoryWaitingPool()
+
+	for _, u := range []*WaitingUser{
+		{Info: MatchRequest{UserID: "easy-arrays", Difficulty: "easy", Topic: "arrays"}},
+		{Info: MatchRequest{UserID: "easy-graphs", Difficulty: "easy", Topic: "graphs"}},
+		{Info: MatchRequest{UserID: "hard-arrays", Difficulty: "hard", Topic: "arrays"}},
+	} {
+		if err := pool.Enqueue(ctx, createMatchKey(u.Info.Difficulty, u.Info.Topic), u); err != nil {
+			t.Fatalf("Enqueue(%s): %v", u.Info.UserID, err)
+		}
+	}
+
+	cfg := DefaultMatcherConfig()
+	matcher := NewRelaxedMatcher(cfg)
+	newUser := &WaitingUser{Info: MatchRequest{Difficulty: "easy", Topic: "arrays"}}
+
+	// Within AnyTopicWindow: every topic, but only within "easy".
+	keys, err := matcher.candidateKeys(ctx, newUser, pool, cfg.AdjacentWindow+time.Second)
+	if err != nil {
+		t.Fatalf("candidateKeys: %v", err)
+	}
+	for _, key := range keys {
+		if key == createMatchKey("hard", "arrays") {
+			t.Fatalf("candidateKeys widened across difficulty before AnyTopicWindow elapsed: %v", keys)
+		}
+	}
+
+	// Past AnyTopicWindow: the true last resort, every bucket.
+	keys, err = matcher.candidateKeys(ctx, newUser, pool, cfg.AnyTopicWindow+time.Second)
+	if err != nil {
+		t.Fatalf("candidateKeys: %v", err)
+	}
+	found := false
+	for _, key := range keys {
+		if key == createMatchKey("hard", "arrays") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected candidateKeys to widen across difficulty past AnyTopicWindow, got %v", keys)
+	}
+}
+
+// TestRelaxedMatcherDoesNotDrainWholeTier guards against a regression
+// where a widened search popped every candidate across every bucket for
+// the tier before scoring, then requeued all the losers. With Peek/PopUser
+// only the winner should ever leave the pool.
+func TestRelaxedMatcherDoesNotDrainWholeTier(t *testing.T) {
+	ctx := context.Background()
+	pool := NewMemoryWaitingPool()
+
+	bystander := &WaitingUser{Info: MatchRequest{UserID: "bystander", Difficulty: "easy", Topic: "graphs", PreferredProgrammingLang: []string{"python"}}, EnqueuedAt: time.Now()}
+	winner := &WaitingUser{Info: MatchRequest{UserID: "winner", Difficulty: "easy", Topic: "arrays", PreferredProgrammingLang: []string{"go"}}, EnqueuedAt: time.Now()}
+
+	if err := pool.Enqueue(ctx, createMatchKey(bystander.Info.Difficulty, bystander.Info.Topic), bystander); err != nil {
+		t.Fatalf("Enqueue(bystander): %v", err)
+	}
+	if err := pool.Enqueue(ctx, createMatchKey(winner.Info.Difficulty, winner.Info.Topic), winner); err != nil {
+		t.Fatalf("Enqueue(winner): %v", err)
+	}
+
+	cfg := DefaultMatcherConfig()
+	matcher := NewRelaxedMatcher(cfg)
+	// Past AnyTopicWindow, so the search widens to every bucket, including
+	// the bystander's "easy"/"graphs" one.
+	newUser := &WaitingUser{
+		Info:       MatchRequest{UserID: "seeker", Difficulty: "easy", Topic: "arrays", PreferredProgrammingLang: []string{"go"}},
+		EnqueuedAt: time.Now().Add(-cfg.AnyTopicWindow - time.Second),
+	}
+
+	matched, _, err := matcher.FindMatch(ctx, newUser, pool)
+	if err != nil {
+		t.Fatalf("FindMatch: %v", err)
+	}
+	if matched == nil || matched.Info.UserID != "winner" {
+		t.Fatalf("expected to match winner, got %v", matched)
+	}
+
+	size, err := pool.Size(ctx, createMatchKey("easy", "graphs"))
+	if err != nil {
+		t.Fatalf("Size: %v", err)
+	}
+	if size != 1 {
+		t.Fatalf("bystander should still be waiting untouched, bucket size = %d", size)
+	}
+}
@@ -7,8 +7,34 @@
 
 package main
 
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Matcher searches the waiting pool for a compatible opponent for
+// newUser. Implementations must leave every candidate they examine but
+// don't choose in its place in the FIFO line: AbsoluteMatcher pops
+// candidates as it searches and requeues the rejected ones, while
+// RelaxedMatcher peeks and pops only the one it picks.
 type Matcher interface {
-	FindMatch(newUser *WaitingUser, pool map[string][]*WaitingUser) (*WaitingUser, string)
+	FindMatch(ctx context.Context, newUser *WaitingUser, pool WaitingPool) (*WaitingUser, string, error)
+}
+
+// requeueRejected puts a popped-but-rejected candidate back in key. If the
+// requeue itself fails, the candidate would otherwise vanish from the pool
+// with nothing logged and nothing ever sent on its NotifyChan, leaving its
+// connection open until its own 30s deadline with no error reported; so on
+// failure this also tells the candidate's stranded connection to give up
+// immediately with EventError.
+func requeueRejected(ctx context.Context, pool WaitingPool, key string, u *WaitingUser) {
+	if err := pool.Requeue(ctx, key, u); err != nil {
+		log.Error().Err(err).Str("userId", u.Info.UserID).Msg("Failed to requeue a rejected candidate.")
+		if notifyErr := pool.Notify(ctx, u, MatchResult{Failed: true}); notifyErr != nil {
+			log.Error().Err(notifyErr).Str("userId", u.Info.UserID).Msg("Failed to notify a candidate stranded by a failed requeue.")
+		}
+	}
 }
 
 type AbsoluteMatcher struct{}
@@ -27,20 +53,33 @@ func findFirstCommonLang(list1 []string, list2 []string) (string, bool) {
 	return "", false // No common language found
 }
 
-func (m *AbsoluteMatcher) FindMatch(newUser *WaitingUser, pool map[string][]*WaitingUser) (*WaitingUser, string) {
+func (m *AbsoluteMatcher) FindMatch(ctx context.Context, newUser *WaitingUser, pool WaitingPool) (*WaitingUser, string, error) {
 	key := createMatchKey(newUser.Info.Difficulty, newUser.Info.Topic)
 
-	opponents := pool[key]
-	if len(opponents) == 0 {
-		return nil, "" // No one is waiting
-	}
+	var rejected []*WaitingUser
+	defer func() {
+		// Requeue oldest-rejected-last: MemoryWaitingPool.Requeue prepends
+		// to the front one at a time, so requeuing in pop order (oldest
+		// first) would push each earlier candidate further back and
+		// reverse their relative order. Reversing here restores it.
+		for i := len(rejected) - 1; i >= 0; i-- {
+			requeueRejected(ctx, pool, key, rejected[i])
+		}
+	}()
 
-	for _, opponent := range opponents {
-		if commonLang, found := findFirstCommonLang(newUser.Info.PreferredProgrammingLang, opponent.Info.PreferredProgrammingLang); found {
-			// Found a match
-			return opponent, commonLang
+	for {
+		candidate, err := pool.PopCandidate(ctx, key)
+		if err != nil {
+			return nil, "", err
+		}
+		if candidate == nil {
+			return nil, "", nil // No one is waiting
 		}
-	}
 
-	return nil, ""
+		if commonLang, found := findFirstCommonLang(newUser.Info.PreferredProgrammingLang, candidate.Info.PreferredProgrammingLang); found {
+			return candidate, commonLang, nil
+		}
+
+		rejected = append(rejected, candidate)
+	}
 }
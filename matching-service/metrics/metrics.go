@@ -0,0 +1,80 @@
+// metrics.go
+
+// Package metrics holds the Prometheus collectors for the matching
+// service, kept separate from the main package so any downstream tooling
+// (or a future second binary) can register against the same collectors
+// without importing the service itself.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// MatchOutcomes counts how match requests were ultimately resolved:
+	// "matched", "timeout", "cancelled" or "error".
+	MatchOutcomes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "matching_outcomes_total",
+			Help: "Count of match requests by how they were resolved.",
+		},
+		[]string{"outcome"},
+	)
+
+	// WaitDuration is how long a user spent in the waiting pool before
+	// their request resolved, one way or another.
+	WaitDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "matching_wait_duration_seconds",
+			Help:    "Time spent waiting for a match, labelled by difficulty and topic.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"difficulty", "topic"},
+	)
+
+	// PoolSize is the current number of users waiting in a bucket.
+	PoolSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "matching_pool_size",
+			Help: "Current number of users waiting in a difficulty/topic bucket.",
+		},
+		[]string{"difficulty", "topic"},
+	)
+
+	// DownstreamDuration is the latency of calls to downstream services.
+	DownstreamDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "matching_downstream_request_duration_seconds",
+			Help:    "Latency of calls to downstream services, labelled by dependency.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"service"},
+	)
+
+	// DownstreamErrors counts failed calls to downstream services.
+	DownstreamErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "matching_downstream_errors_total",
+			Help: "Count of failed calls to downstream services, labelled by dependency.",
+		},
+		[]string{"service"},
+	)
+
+	// Requeues counts users put back in the waiting pool after a
+	// downstream failure instead of being dropped from their match.
+	Requeues = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "matching_requeues_total",
+			Help: "Count of users re-enqueued after a downstream failure instead of being dropped.",
+		},
+		[]string{"reason"},
+	)
+)
+
+func init() {
+	// The Go runtime and process collectors are registered onto
+	// DefaultRegisterer by the prometheus package itself; registering
+	// them again here would panic with "duplicate metrics collector
+	// registration attempted".
+	prometheus.MustRegister(MatchOutcomes, WaitDuration, PoolSize, DownstreamDuration, DownstreamErrors, Requeues)
+}
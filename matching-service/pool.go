@@ -0,0 +1,81 @@
+// pool.go
+
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/CS3219-AY2526Sem1/cs3219-ay2526s1-project-g30/matching-service/metrics"
+)
+
+// WaitingPool abstracts where users waiting for a match are stored. This
+// lets MatchingService and the Matcher implementations stay unaware of
+// whether they are talking to a single process's memory or to a shared
+// Redis instance backing several replicas behind a load balancer.
+//
+// Implementations are responsible for their own concurrency control:
+// Enqueue/PopCandidate/Remove must be safe to call concurrently, including
+// from other processes in the case of a shared backend.
+type WaitingPool interface {
+	// Enqueue records user as waiting at the back of the given bucket, so
+	// buckets are served oldest-first. Removing a user whose wait has
+	// timed out is left to the caller (see Remove).
+	Enqueue(ctx context.Context, key string, user *WaitingUser) error
+
+	// PopCandidate atomically removes and returns the longest-waiting user
+	// in the given bucket, or nil if the bucket is empty. A candidate is
+	// handed to at most one caller, even across replicas.
+	PopCandidate(ctx context.Context, key string) (*WaitingUser, error)
+
+	// Requeue puts a popped-but-rejected candidate back in its bucket,
+	// preserving its original enqueue time so it doesn't lose its place
+	// in line just because it was examined and skipped.
+	Requeue(ctx context.Context, key string, user *WaitingUser) error
+
+	// Remove deletes userID from the pool outright, for the cancel and
+	// timeout paths. It returns the removed user, or nil if userID was
+	// not waiting anywhere.
+	Remove(ctx context.Context, userID string) (*WaitingUser, error)
+
+	// KeysWithPrefix lists bucket keys starting with prefix, so matchers
+	// can widen a search (e.g. to every topic within a difficulty).
+	KeysWithPrefix(ctx context.Context, prefix string) ([]string, error)
+
+	// Peek returns the users currently waiting in key without removing
+	// them, so a matcher can score every candidate across a widened
+	// search before committing to pop any of them.
+	Peek(ctx context.Context, key string) ([]*WaitingUser, error)
+
+	// PopUser atomically removes userID from key if they are still
+	// waiting there, or returns nil if someone else already popped them
+	// first (e.g. a different widened search matched them first). A
+	// candidate is handed to at most one caller, even across replicas.
+	PopUser(ctx context.Context, key string, userID string) (*WaitingUser, error)
+
+	// Size reports how many users are currently waiting in a bucket, used
+	// to estimate queue position for progress updates.
+	Size(ctx context.Context, key string) (int, error)
+
+	// Notify delivers a result to user. If user.NotifyChan is set (it was
+	// enqueued by this instance and we still hold the live pointer) the
+	// send is direct. Otherwise user was obtained from a shared backend
+	// without its channel attached, so Notify publishes the result for
+	// the instance that actually holds the waiting connection to pick up.
+	Notify(ctx context.Context, user *WaitingUser, result MatchResult) error
+}
+
+// waitTimeout is how long a user may sit in the pool before being removed
+// and told no match was found.
+const waitTimeout = 30 * time.Second
+
+// setPoolSizeMetric records a bucket's current size right as a pool
+// implementation mutates it (Enqueue/PopCandidate/PopUser/Requeue/Remove),
+// rather than leaving it to be refreshed opportunistically by some other
+// waiter's queue_update ticker. Without this, a bucket's gauge freezes at
+// its last observed value once the last waiter in it is matched,
+// cancelled, or times out, instead of reporting it's now empty.
+func setPoolSizeMetric(difficulty, topic string, size int) {
+	metrics.PoolSize.WithLabelValues(strings.ToLower(difficulty), strings.ToLower(topic)).Set(float64(size))
+}
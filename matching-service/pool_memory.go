@@ -0,0 +1,138 @@
+// pool_memory.go
+
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryWaitingPool is the original single-process implementation of
+// WaitingPool: a map of buckets guarded by a mutex. It is still the
+// default so local dev and single-replica deployments don't need Redis.
+type MemoryWaitingPool struct {
+	mutex     sync.Mutex
+	buckets   map[string][]*WaitingUser
+	userIndex map[string]*WaitingUser
+}
+
+func NewMemoryWaitingPool() *MemoryWaitingPool {
+	return &MemoryWaitingPool{
+		buckets:   make(map[string][]*WaitingUser),
+		userIndex: make(map[string]*WaitingUser),
+	}
+}
+
+func (p *MemoryWaitingPool) Enqueue(ctx context.Context, key string, user *WaitingUser) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.buckets[key] = append(p.buckets[key], user)
+	p.userIndex[user.Info.UserID] = user
+	setPoolSizeMetric(user.Info.Difficulty, user.Info.Topic, len(p.buckets[key]))
+	return nil
+}
+
+func (p *MemoryWaitingPool) PopCandidate(ctx context.Context, key string) (*WaitingUser, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	users := p.buckets[key]
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	candidate := users[0]
+	p.buckets[key] = users[1:]
+	delete(p.userIndex, candidate.Info.UserID)
+	setPoolSizeMetric(candidate.Info.Difficulty, candidate.Info.Topic, len(p.buckets[key]))
+	return candidate, nil
+}
+
+func (p *MemoryWaitingPool) Requeue(ctx context.Context, key string, user *WaitingUser) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.buckets[key] = append([]*WaitingUser{user}, p.buckets[key]...)
+	p.userIndex[user.Info.UserID] = user
+	setPoolSizeMetric(user.Info.Difficulty, user.Info.Topic, len(p.buckets[key]))
+	return nil
+}
+
+func (p *MemoryWaitingPool) Remove(ctx context.Context, userID string) (*WaitingUser, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	user, found := p.userIndex[userID]
+	if !found {
+		return nil, nil
+	}
+	delete(p.userIndex, userID)
+
+	key := createMatchKey(user.Info.Difficulty, user.Info.Topic)
+	users := p.buckets[key]
+	for i, u := range users {
+		if u.Info.UserID == userID {
+			p.buckets[key] = append(users[:i], users[i+1:]...)
+			break
+		}
+	}
+	setPoolSizeMetric(user.Info.Difficulty, user.Info.Topic, len(p.buckets[key]))
+	return user, nil
+}
+
+func (p *MemoryWaitingPool) Peek(ctx context.Context, key string) ([]*WaitingUser, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	users := p.buckets[key]
+	out := make([]*WaitingUser, len(users))
+	copy(out, users)
+	return out, nil
+}
+
+func (p *MemoryWaitingPool) PopUser(ctx context.Context, key string, userID string) (*WaitingUser, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	users := p.buckets[key]
+	for i, u := range users {
+		if u.Info.UserID == userID {
+			p.buckets[key] = append(append([]*WaitingUser{}, users[:i]...), users[i+1:]...)
+			delete(p.userIndex, userID)
+			setPoolSizeMetric(u.Info.Difficulty, u.Info.Topic, len(p.buckets[key]))
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *MemoryWaitingPool) KeysWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var keys []string
+	for key, users := range p.buckets {
+		if len(users) == 0 {
+			continue
+		}
+		if len(key) >= len(prefix) && key[:len(prefix)] == prefix {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (p *MemoryWaitingPool) Size(ctx context.Context, key string) (int, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return len(p.buckets[key]), nil
+}
+
+func (p *MemoryWaitingPool) Notify(ctx context.Context, user *WaitingUser, result MatchResult) error {
+	if user.NotifyChan != nil {
+		user.NotifyChan <- result
+	}
+	return nil
+}
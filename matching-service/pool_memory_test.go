@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// TestAbsoluteMatcherPreservesFIFOOrder guards against a regression where
+// requeuing rejected candidates in pop order reverses their place in line:
+// MemoryWaitingPool.Requeue prepends one candidate at a time, so requeuing
+// oldest-first pushes each earlier candidate further back every time.
+func TestAbsoluteMatcherPreservesFIFOOrder(t *testing.T) {
+	ctx := context.Background()
+	pool := NewMemoryWaitingPool()
+	key := createMatchKey("easy", "arrays")
+
+	oldest := &WaitingUser{Info: MatchRequest{UserID: "oldest", Difficulty: "easy", Topic: "arrays", PreferredProgrammingLang: []string{"go"}}}
+	middle := &WaitingUser{Info: MatchRequest{UserID: "middle", Difficulty: "easy", Topic: "arrays", PreferredProgrammingLang: []string{"python"}}}
+	newest := &WaitingUser{Info: MatchRequest{UserID: "newest", Difficulty: "easy", Topic: "arrays", PreferredProgrammingLang: []string{"java"}}}
+
+	for _, u := range []*WaitingUser{oldest, middle, newest} {
+		if err := pool.Enqueue(ctx, key, u); err != nil {
+			t.Fatalf("Enqueue(%s): %v", u.Info.UserID, err)
+		}
+	}
+
+	// A searcher with no language in common with any of them rejects all
+	// three and requeues them without picking anyone.
+	seeker := &WaitingUser{Info: MatchRequest{UserID: "seeker", Difficulty: "easy", Topic: "arrays", PreferredProgrammingLang: []string{"rust"}}}
+	matcher := &AbsoluteMatcher{}
+	candidate, _, err := matcher.FindMatch(ctx, seeker, pool)
+	if err != nil {
+		t.Fatalf("FindMatch: %v", err)
+	}
+	if candidate != nil {
+		t.Fatalf("expected no match, got %s", candidate.Info.UserID)
+	}
+
+	for _, want := range []string{"oldest", "middle", "newest"} {
+		got, err := pool.PopCandidate(ctx, key)
+		if err != nil {
+			t.Fatalf("PopCandidate: %v", err)
+		}
+		if got == nil || got.Info.UserID != want {
+			t.Fatalf("FIFO order broken: want %s next, got %v", want, got)
+		}
+	}
+}
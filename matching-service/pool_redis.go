@@ -0,0 +1,276 @@
+// pool_redis.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// RedisWaitingPool backs WaitingPool with Redis so several replicas of the
+// matching service can share one pool: a user waiting on replica A can be
+// paired with a user arriving on replica B. Each bucket is a sorted set
+// scored by enqueue time (FIFO order, and the same score lets a reaper
+// find stale entries), and cross-instance match notification goes over
+// Redis Pub/Sub since the channel that's actually being long-polled only
+// exists in the memory of whichever replica accepted that connection.
+type RedisWaitingPool struct {
+	client    *redis.Client
+	keyPrefix string
+
+	popScript     *redis.Script
+	requeueScript *redis.Script
+}
+
+const redisNotifyChannelPrefix = "match:notify:"
+
+func NewRedisWaitingPool(client *redis.Client) *RedisWaitingPool {
+	return &RedisWaitingPool{
+		client:    client,
+		keyPrefix: "match:pool:",
+		// POP removes and returns the oldest member of the bucket in one
+		// round trip, so two instances racing to serve the same waiter
+		// can never both succeed.
+		popScript: redis.NewScript(`
+			local entries = redis.call("ZRANGE", KEYS[1], 0, 0)
+			if #entries == 0 then
+				return false
+			end
+			redis.call("ZREM", KEYS[1], entries[1])
+			return entries[1]
+		`),
+		// REQUEUE restores a popped-but-rejected candidate at its
+		// original score so it keeps its place in the FIFO line.
+		requeueScript: redis.NewScript(`
+			redis.call("ZADD", KEYS[1], ARGV[1], ARGV[2])
+			return redis.status_reply("OK")
+		`),
+	}
+}
+
+type redisWaitingUser struct {
+	Info       MatchRequest `json:"info"`
+	EnqueuedAt time.Time    `json:"enqueuedAt"`
+}
+
+func (p *RedisWaitingPool) userKey(userID string) string {
+	return p.keyPrefix + "user:" + userID
+}
+
+// refreshPoolSizeMetric re-reads key's current size and publishes it, right
+// after an operation that changed it, so the gauge doesn't go stale once a
+// bucket's last waiter leaves. Best-effort: a failure here only means one
+// missed metric refresh, not a reason to fail the caller's real operation.
+func (p *RedisWaitingPool) refreshPoolSizeMetric(ctx context.Context, key, difficulty, topic string) {
+	n, err := p.client.ZCard(ctx, p.keyPrefix+key).Result()
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Failed to refresh pool size metric")
+		return
+	}
+	setPoolSizeMetric(difficulty, topic, int(n))
+}
+
+func (p *RedisWaitingPool) Enqueue(ctx context.Context, key string, user *WaitingUser) error {
+	// Subscribe, and wait for Redis to confirm the subscription is active,
+	// *before* the entry becomes poppable. Otherwise another instance can
+	// pop this entry and Publish a result before our relay goroutine has
+	// even called Subscribe, and the notification is lost: the caller
+	// waits out the full timeout and reports a false negative even though
+	// the match actually succeeded.
+	sub := p.client.Subscribe(ctx, redisNotifyChannelPrefix+user.Info.UserID)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return err
+	}
+
+	payload, err := json.Marshal(redisWaitingUser{Info: user.Info, EnqueuedAt: user.EnqueuedAt})
+	if err != nil {
+		sub.Close()
+		return err
+	}
+
+	score := float64(user.EnqueuedAt.UnixNano())
+	pipe := p.client.TxPipeline()
+	pipe.Set(ctx, p.userKey(user.Info.UserID), payload, waitTimeout+5*time.Second)
+	pipe.ZAdd(ctx, p.keyPrefix+key, redis.Z{Score: score, Member: user.Info.UserID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		sub.Close()
+		return err
+	}
+
+	p.refreshPoolSizeMetric(ctx, key, user.Info.Difficulty, user.Info.Topic)
+
+	// Relay any result published for this user onto its local channel, so
+	// ProcessMatchRequest can keep waiting on NotifyChan exactly as it
+	// does with the in-memory pool. The subscription is already live, so
+	// nothing published after this point can be missed.
+	go p.relayNotifications(user, sub)
+	return nil
+}
+
+func (p *RedisWaitingPool) relayNotifications(user *WaitingUser, sub *redis.PubSub) {
+	defer sub.Close()
+
+	select {
+	case msg, ok := <-sub.Channel():
+		if !ok {
+			return
+		}
+		var result MatchResult
+		if err := json.Unmarshal([]byte(msg.Payload), &result); err != nil {
+			log.Error().Err(err).Str("userId", user.Info.UserID).Msg("Failed to decode match notification")
+			return
+		}
+		user.NotifyChan <- result
+	case <-time.After(waitTimeout + 5*time.Second):
+		// ProcessMatchRequest's own timeout will have fired by now.
+	}
+}
+
+func (p *RedisWaitingPool) PopCandidate(ctx context.Context, key string) (*WaitingUser, error) {
+	res, err := p.popScript.Run(ctx, p.client, []string{p.keyPrefix + key}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := res.(bool); ok && !b {
+		return nil, nil
+	}
+	userID, ok := res.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected pop result type %T", res)
+	}
+
+	candidate, err := p.loadAndForget(ctx, userID)
+	if err != nil || candidate == nil {
+		return candidate, err
+	}
+	p.refreshPoolSizeMetric(ctx, key, candidate.Info.Difficulty, candidate.Info.Topic)
+	return candidate, nil
+}
+
+func (p *RedisWaitingPool) loadAndForget(ctx context.Context, userID string) (*WaitingUser, error) {
+	data, err := p.client.GetDel(ctx, p.userKey(userID)).Result()
+	if err == redis.Nil {
+		// The entry's TTL expired between the ZSET pop and this GET; treat
+		// it the same as an empty bucket rather than erroring the match.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored redisWaitingUser
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, err
+	}
+	return &WaitingUser{Info: stored.Info, EnqueuedAt: stored.EnqueuedAt}, nil
+}
+
+func (p *RedisWaitingPool) Requeue(ctx context.Context, key string, user *WaitingUser) error {
+	payload, err := json.Marshal(redisWaitingUser{Info: user.Info, EnqueuedAt: user.EnqueuedAt})
+	if err != nil {
+		return err
+	}
+	if err := p.client.Set(ctx, p.userKey(user.Info.UserID), payload, waitTimeout+5*time.Second).Err(); err != nil {
+		return err
+	}
+	if err := p.requeueScript.Run(ctx, p.client, []string{p.keyPrefix + key}, float64(user.EnqueuedAt.UnixNano()), user.Info.UserID).Err(); err != nil {
+		return err
+	}
+	p.refreshPoolSizeMetric(ctx, key, user.Info.Difficulty, user.Info.Topic)
+	return nil
+}
+
+func (p *RedisWaitingPool) Remove(ctx context.Context, userID string) (*WaitingUser, error) {
+	user, err := p.loadAndForget(ctx, userID)
+	if err != nil || user == nil {
+		return user, err
+	}
+	bucketKey := createMatchKey(user.Info.Difficulty, user.Info.Topic)
+	p.client.ZRem(ctx, p.keyPrefix+bucketKey, userID)
+	p.refreshPoolSizeMetric(ctx, bucketKey, user.Info.Difficulty, user.Info.Topic)
+	return user, nil
+}
+
+func (p *RedisWaitingPool) Peek(ctx context.Context, key string) ([]*WaitingUser, error) {
+	ids, err := p.client.ZRange(ctx, p.keyPrefix+key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*WaitingUser, 0, len(ids))
+	for _, userID := range ids {
+		data, err := p.client.Get(ctx, p.userKey(userID)).Result()
+		if err == redis.Nil {
+			// Expired between the ZRANGE and this GET; just not a
+			// candidate anymore, not a reason to fail the whole peek.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var stored redisWaitingUser
+		if err := json.Unmarshal([]byte(data), &stored); err != nil {
+			return nil, err
+		}
+		users = append(users, &WaitingUser{Info: stored.Info, EnqueuedAt: stored.EnqueuedAt})
+	}
+	return users, nil
+}
+
+func (p *RedisWaitingPool) PopUser(ctx context.Context, key string, userID string) (*WaitingUser, error) {
+	removed, err := p.client.ZRem(ctx, p.keyPrefix+key, userID).Result()
+	if err != nil {
+		return nil, err
+	}
+	if removed == 0 {
+		return nil, nil // already popped by another search
+	}
+	user, err := p.loadAndForget(ctx, userID)
+	if err != nil || user == nil {
+		return user, err
+	}
+	p.refreshPoolSizeMetric(ctx, key, user.Info.Difficulty, user.Info.Topic)
+	return user, nil
+}
+
+func (p *RedisWaitingPool) KeysWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	iter := p.client.Scan(ctx, 0, p.keyPrefix+prefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()[len(p.keyPrefix):]
+		if strings.HasPrefix(key, "user:") {
+			// A user's payload (see userKey), not a bucket.
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, iter.Err()
+}
+
+func (p *RedisWaitingPool) Size(ctx context.Context, key string) (int, error) {
+	n, err := p.client.ZCard(ctx, p.keyPrefix+key).Result()
+	return int(n), err
+}
+
+func (p *RedisWaitingPool) Notify(ctx context.Context, user *WaitingUser, result MatchResult) error {
+	if user.NotifyChan != nil {
+		user.NotifyChan <- result
+		return nil
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return p.client.Publish(ctx, redisNotifyChannelPrefix+user.Info.UserID, payload).Err()
+}
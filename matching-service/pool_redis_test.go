@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// TestRedisWaitingPoolNeverLosesAnImmediateNotify guards against a race
+// where Enqueue returned before its relay goroutine had subscribed: if
+// another instance popped the entry and published a result in that
+// window, the notification was silently dropped and the waiter hung until
+// its own timeout despite actually having been matched. Enqueue now
+// blocks until the subscription is confirmed live before returning, so a
+// pop-then-publish immediately afterwards must always be delivered.
+func TestRedisWaitingPoolNeverLosesAnImmediateNotify(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis.Run: %v", err)
+	}
+	defer server.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	pool := NewRedisWaitingPool(client)
+	ctx := context.Background()
+	key := createMatchKey("easy", "arrays")
+
+	user := &WaitingUser{
+		Info:       MatchRequest{UserID: "u1", Difficulty: "easy", Topic: "arrays", PreferredProgrammingLang: []string{"go"}},
+		NotifyChan: make(chan MatchResult, 1),
+		EnqueuedAt: time.Now(),
+	}
+
+	if err := pool.Enqueue(ctx, key, user); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	// Simulate a second instance immediately popping the entry and
+	// publishing a match, exactly as ProcessMatchRequest would after
+	// FindMatch succeeds on another replica.
+	popped, err := pool.PopCandidate(ctx, key)
+	if err != nil {
+		t.Fatalf("PopCandidate: %v", err)
+	}
+	if popped == nil || popped.Info.UserID != "u1" {
+		t.Fatalf("expected to pop u1, got %v", popped)
+	}
+
+	want := MatchResult{SessionID: "s1", User1ID: "other", User2ID: "u1"}
+	if err := pool.Notify(ctx, popped, want); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	select {
+	case got := <-user.NotifyChan:
+		if got.SessionID != want.SessionID {
+			t.Fatalf("got %+v, want %+v", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("notification was lost: Enqueue returned before its subscription was live")
+	}
+}
@@ -0,0 +1,209 @@
+// postgres.go
+
+package repo
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// matchRow and eventRow are the gorm models backing the matches and
+// match_events tables. They're kept separate from Match/Event so gorm
+// tags don't leak into the rest of the service.
+type matchRow struct {
+	ID              uint   `gorm:"primaryKey"`
+	SessionID       string `gorm:"uniqueIndex;size:64"`
+	User1ID         string `gorm:"index;size:64"`
+	User2ID         string `gorm:"index;size:64"`
+	QuestionID      string `gorm:"size:64"`
+	Difficulty      string `gorm:"index;size:32"`
+	Topic           string `gorm:"index;size:64"`
+	ProgrammingLang string `gorm:"size:32"`
+	MatchedAt       time.Time
+	User1WaitMs     int64
+	User2WaitMs     int64
+}
+
+func (matchRow) TableName() string { return "matches" }
+
+type eventRow struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     string `gorm:"index;size:64"`
+	Difficulty string `gorm:"index;size:32"`
+	Topic      string `gorm:"index;size:64"`
+	Outcome    string `gorm:"index;size:16"`
+	OccurredAt time.Time
+	WaitMs     int64
+}
+
+func (eventRow) TableName() string { return "match_events" }
+
+// PostgresRepo is the Postgres-backed Repo. See migrations/0001_init.sql
+// for the schema this mirrors; AutoMigrate is what actually applies it.
+type PostgresRepo struct {
+	db *gorm.DB
+}
+
+// NewPostgresRepo opens databaseURL and auto-migrates the schema.
+func NewPostgresRepo(databaseURL string) (*PostgresRepo, error) {
+	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.AutoMigrate(&matchRow{}, &eventRow{}); err != nil {
+		return nil, err
+	}
+	return &PostgresRepo{db: db}, nil
+}
+
+func (r *PostgresRepo) RecordMatch(ctx context.Context, m Match) error {
+	row := matchRow{
+		SessionID:       m.SessionID,
+		User1ID:         m.User1ID,
+		User2ID:         m.User2ID,
+		QuestionID:      m.QuestionID,
+		Difficulty:      m.Difficulty,
+		Topic:           m.Topic,
+		ProgrammingLang: m.ProgrammingLang,
+		MatchedAt:       m.MatchedAt,
+		User1WaitMs:     m.User1WaitMs,
+		User2WaitMs:     m.User2WaitMs,
+	}
+	return r.db.WithContext(ctx).Create(&row).Error
+}
+
+func (r *PostgresRepo) RecordEvent(ctx context.Context, e Event) error {
+	row := eventRow{
+		UserID:     e.UserID,
+		Difficulty: e.Difficulty,
+		Topic:      e.Topic,
+		Outcome:    e.Outcome,
+		OccurredAt: e.OccurredAt,
+		WaitMs:     e.WaitMs,
+	}
+	return r.db.WithContext(ctx).Create(&row).Error
+}
+
+func (r *PostgresRepo) History(ctx context.Context, userID string, limit, offset int) ([]HistoryEntry, int64, error) {
+	query := r.db.WithContext(ctx).Model(&matchRow{}).
+		Where("user1_id = ? OR user2_id = ?", userID, userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rows []matchRow
+	if err := query.Order("matched_at DESC").Limit(limit).Offset(offset).Find(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]HistoryEntry, 0, len(rows))
+	for _, row := range rows {
+		opponentID, waitMs := row.User2ID, row.User1WaitMs
+		if row.User1ID != userID {
+			opponentID, waitMs = row.User1ID, row.User2WaitMs
+		}
+		entries = append(entries, HistoryEntry{
+			SessionID:       row.SessionID,
+			OpponentID:      opponentID,
+			QuestionID:      row.QuestionID,
+			Difficulty:      row.Difficulty,
+			Topic:           row.Topic,
+			ProgrammingLang: row.ProgrammingLang,
+			MatchedAt:       row.MatchedAt,
+			WaitMs:          waitMs,
+		})
+	}
+	return entries, total, nil
+}
+
+func (r *PostgresRepo) Stats(ctx context.Context) (Stats, error) {
+	stats := Stats{ByDifficulty: map[string]BucketStats{}, ByTopic: map[string]BucketStats{}}
+
+	var matchCount int64
+	if err := r.db.WithContext(ctx).Model(&matchRow{}).Count(&matchCount).Error; err != nil {
+		return stats, err
+	}
+	if matchCount > 0 {
+		if err := r.db.WithContext(ctx).Model(&matchRow{}).
+			Select("AVG((user1_wait_ms + user2_wait_ms) / 2.0)").
+			Row().Scan(&stats.AverageWaitMs); err != nil {
+			return stats, err
+		}
+	}
+
+	var timeoutCount, cancelCount int64
+	if err := r.db.WithContext(ctx).Model(&eventRow{}).Where("outcome = ?", "timeout").Count(&timeoutCount).Error; err != nil {
+		return stats, err
+	}
+	if err := r.db.WithContext(ctx).Model(&eventRow{}).Where("outcome = ?", "cancelled").Count(&cancelCount).Error; err != nil {
+		return stats, err
+	}
+	if total := matchCount + timeoutCount + cancelCount; total > 0 {
+		stats.MatchRate = float64(matchCount) / float64(total)
+	}
+
+	if err := r.fillBucketStats(ctx, &stats); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// fillBucketStats fills ByDifficulty/ByTopic with per-bucket match counts,
+// average wait and event counts.
+func (r *PostgresRepo) fillBucketStats(ctx context.Context, stats *Stats) error {
+	dims := []struct {
+		column string
+		target map[string]BucketStats
+	}{
+		{"difficulty", stats.ByDifficulty},
+		{"topic", stats.ByTopic},
+	}
+
+	for _, dim := range dims {
+		var matchAggregates []struct {
+			Key     string
+			Count   int64
+			AvgWait float64
+		}
+		if err := r.db.WithContext(ctx).Model(&matchRow{}).
+			Select(dim.column + " AS key, COUNT(*) AS count, AVG((user1_wait_ms + user2_wait_ms) / 2.0) AS avg_wait").
+			Group(dim.column).
+			Scan(&matchAggregates).Error; err != nil {
+			return err
+		}
+		for _, agg := range matchAggregates {
+			b := dim.target[agg.Key]
+			b.Matches = agg.Count
+			b.AverageWaitMs = agg.AvgWait
+			dim.target[agg.Key] = b
+		}
+
+		var eventAggregates []struct {
+			Key     string
+			Outcome string
+			Count   int64
+		}
+		if err := r.db.WithContext(ctx).Model(&eventRow{}).
+			Select(dim.column + " AS key, outcome, COUNT(*) AS count").
+			Group(dim.column + ", outcome").
+			Scan(&eventAggregates).Error; err != nil {
+			return err
+		}
+		for _, agg := range eventAggregates {
+			b := dim.target[agg.Key]
+			switch agg.Outcome {
+			case "timeout":
+				b.Timeouts = agg.Count
+			case "cancelled":
+				b.Cancellations = agg.Count
+			}
+			dim.target[agg.Key] = b
+		}
+	}
+	return nil
+}
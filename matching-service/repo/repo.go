@@ -0,0 +1,91 @@
+// repo.go
+
+// Package repo persists match outcomes so they can be queried later (see
+// the /api/v1/match/history and /api/v1/match/stats endpoints) and so the
+// relaxed matcher's wait-time estimates can eventually be grounded in
+// real data instead of guesses. Persistence is optional: the service uses
+// NoopRepo when DATABASE_URL isn't set, so local dev without Postgres
+// running still works.
+package repo
+
+import (
+	"context"
+	"time"
+)
+
+// Match is one completed match between two users.
+type Match struct {
+	SessionID       string
+	User1ID         string
+	User2ID         string
+	QuestionID      string
+	Difficulty      string
+	Topic           string
+	ProgrammingLang string
+	MatchedAt       time.Time
+	User1WaitMs     int64
+	User2WaitMs     int64
+}
+
+// Event is a match request that didn't end in a match.
+type Event struct {
+	UserID     string
+	Difficulty string
+	Topic      string
+	Outcome    string // "cancelled" or "timeout"
+	OccurredAt time.Time
+	WaitMs     int64
+}
+
+// HistoryEntry is one row of a user's match history, from their own
+// point of view (OpponentID/WaitMs are relative to the queried user).
+type HistoryEntry struct {
+	SessionID       string    `json:"sessionId"`
+	OpponentID      string    `json:"opponentId"`
+	QuestionID      string    `json:"questionId"`
+	Difficulty      string    `json:"difficulty"`
+	Topic           string    `json:"topic"`
+	ProgrammingLang string    `json:"programmingLang"`
+	MatchedAt       time.Time `json:"matchedAt"`
+	WaitMs          int64     `json:"waitMs"`
+}
+
+// BucketStats aggregates outcomes for one difficulty or topic value.
+type BucketStats struct {
+	Matches       int64   `json:"matches"`
+	Timeouts      int64   `json:"timeouts"`
+	Cancellations int64   `json:"cancellations"`
+	AverageWaitMs float64 `json:"averageWaitMs"`
+}
+
+// Stats is the aggregate response for /api/v1/match/stats.
+type Stats struct {
+	AverageWaitMs float64                `json:"averageWaitMs"`
+	MatchRate     float64                `json:"matchRate"`
+	ByDifficulty  map[string]BucketStats `json:"byDifficulty"`
+	ByTopic       map[string]BucketStats `json:"byTopic"`
+}
+
+// Repo persists match history. Implementations must be safe for
+// concurrent use.
+type Repo interface {
+	RecordMatch(ctx context.Context, m Match) error
+	RecordEvent(ctx context.Context, e Event) error
+	History(ctx context.Context, userID string, limit, offset int) ([]HistoryEntry, int64, error)
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// NoopRepo discards everything it's given. It's the default Repo so
+// local dev without DATABASE_URL set still works.
+type NoopRepo struct{}
+
+func (NoopRepo) RecordMatch(ctx context.Context, m Match) error { return nil }
+func (NoopRepo) RecordEvent(ctx context.Context, e Event) error { return nil }
+
+func (NoopRepo) History(ctx context.Context, userID string, limit, offset int) ([]HistoryEntry, int64, error) {
+	return nil, 0, nil
+}
+
+func (NoopRepo) Stats(ctx context.Context) (Stats, error) {
+	return Stats{ByDifficulty: map[string]BucketStats{}, ByTopic: map[string]BucketStats{}}, nil
+}
@@ -0,0 +1,81 @@
+// repo_handlers.go
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// createMatchHistoryHandler serves a paginated list of a user's past
+// matches, most recent first.
+func createMatchHistoryHandler(service *MatchingService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Query("userId")
+		if userID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+			return
+		}
+
+		limit := defaultHistoryLimit
+		if raw := c.Query("limit"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+			limit = parsed
+		}
+		if limit > maxHistoryLimit {
+			limit = maxHistoryLimit
+		}
+
+		offset := 0
+		if raw := c.Query("offset"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+				return
+			}
+			offset = parsed
+		}
+
+		entries, total, err := service.repo.History(c.Request.Context(), userID, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch match history"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   entries,
+			"total":  total,
+			"limit":  limit,
+			"offset": offset,
+		})
+	}
+}
+
+// createMatchStatsHandler serves aggregate matching stats, broken down by
+// difficulty and topic, for the relaxed matcher's estimates and an
+// eventual admin dashboard.
+func createMatchStatsHandler(service *MatchingService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := service.repo.Stats(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute match stats"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   stats,
+		})
+	}
+}
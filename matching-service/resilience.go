@@ -0,0 +1,161 @@
+// resilience.go
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+// RetryConfig controls the exponential-backoff retry policy a
+// ResilientClient applies on top of a dependency's own timeout.
+type RetryConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func envInt(key string, fallback int) int {
+	raw, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+func envMillis(key string, fallback time.Duration) time.Duration {
+	raw, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	ms, err := strconv.Atoi(raw)
+	if err != nil {
+		return fallback
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// retryConfigFromEnv reads DOWNSTREAM_RETRY_MAX_ATTEMPTS,
+// DOWNSTREAM_RETRY_BASE_DELAY_MS and DOWNSTREAM_RETRY_MAX_DELAY_MS so the
+// retry policy can be tuned per environment without a code change.
+// MaxAttempts is floored at 1: a non-positive value would make
+// doWithRetry's loop never run, so every call would fail without a
+// request ever being sent.
+func retryConfigFromEnv() RetryConfig {
+	maxAttempts := envInt("DOWNSTREAM_RETRY_MAX_ATTEMPTS", 3)
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return RetryConfig{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   envMillis("DOWNSTREAM_RETRY_BASE_DELAY_MS", 200*time.Millisecond),
+		MaxDelay:    envMillis("DOWNSTREAM_RETRY_MAX_DELAY_MS", 2*time.Second),
+	}
+}
+
+// breakerSettings reads DOWNSTREAM_BREAKER_FAILURE_THRESHOLD,
+// DOWNSTREAM_BREAKER_OPEN_SECONDS and DOWNSTREAM_BREAKER_INTERVAL_SECONDS
+// so a sick dependency trips its breaker instead of chewing up every
+// match's retry budget.
+func breakerSettings(name string) gobreaker.Settings {
+	threshold := uint32(envInt("DOWNSTREAM_BREAKER_FAILURE_THRESHOLD", 5))
+	return gobreaker.Settings{
+		Name:        name,
+		MaxRequests: 1,
+		Interval:    envSeconds("DOWNSTREAM_BREAKER_INTERVAL_SECONDS", 60*time.Second),
+		Timeout:     envSeconds("DOWNSTREAM_BREAKER_OPEN_SECONDS", 30*time.Second),
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= threshold
+		},
+	}
+}
+
+// ResilientClient wraps an *http.Client with retry/backoff and a circuit
+// breaker, so one flaky downstream doesn't chew through the matching
+// budget on every request, and a genuinely unhealthy one fails fast
+// instead of being retried into the ground.
+type ResilientClient struct {
+	http    *http.Client
+	retry   RetryConfig
+	breaker *gobreaker.CircuitBreaker
+}
+
+func NewResilientClient(name string, httpClient *http.Client) *ResilientClient {
+	return &ResilientClient{
+		http:    httpClient,
+		retry:   retryConfigFromEnv(),
+		breaker: gobreaker.NewCircuitBreaker(breakerSettings(name)),
+	}
+}
+
+// Do executes req, retrying on connection errors or 5xx responses with
+// exponential backoff and jitter, guarded by the circuit breaker.
+func (c *ResilientClient) Do(req *http.Request) (*http.Response, error) {
+	result, err := c.breaker.Execute(func() (interface{}, error) {
+		return c.doWithRetry(req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*http.Response), nil
+}
+
+func (c *ResilientClient) doWithRetry(req *http.Request) (*http.Response, error) {
+	lastErr := fmt.Errorf("retry config allows no attempts (MaxAttempts=%d)", c.retry.MaxAttempts)
+	for attempt := 0; attempt < c.retry.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoffDelay(c.retry, attempt))
+		}
+
+		attemptReq := cloneRequest(req)
+		resp, err := c.http.Do(attemptReq)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("downstream returned %d", resp.StatusCode)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// cloneRequest returns a request safe to retry: req itself if it has no
+// body to worry about (e.g. a GET), or a clone with a fresh body reader
+// otherwise so a failed attempt doesn't leave the body already drained.
+func cloneRequest(req *http.Request) *http.Request {
+	if req.Body == nil || req.GetBody == nil {
+		return req
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return req
+	}
+	clone := req.Clone(req.Context())
+	clone.Body = body
+	return clone
+}
+
+// backoffDelay computes an exponential delay for the given attempt
+// (1-indexed retry count), capped at cfg.MaxDelay and jittered so many
+// concurrent retries don't all land on the dependency at once.
+func backoffDelay(cfg RetryConfig, attempt int) time.Duration {
+	delay := cfg.BaseDelay * time.Duration(int64(1)<<uint(attempt-1))
+	if delay > cfg.MaxDelay {
+		delay = cfg.MaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
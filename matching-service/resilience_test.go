@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// TestRetryConfigFromEnvFloorsMaxAttempts guards against a regression
+// where DOWNSTREAM_RETRY_MAX_ATTEMPTS=0 (or negative) made doWithRetry's
+// loop never run, returning a nil *http.Response with a nil error, which
+// panicked every caller's deferred resp.Body.Close().
+func TestRetryConfigFromEnvFloorsMaxAttempts(t *testing.T) {
+	t.Setenv("DOWNSTREAM_RETRY_MAX_ATTEMPTS", "0")
+	if got := retryConfigFromEnv().MaxAttempts; got < 1 {
+		t.Fatalf("MaxAttempts = %d, want >= 1", got)
+	}
+
+	t.Setenv("DOWNSTREAM_RETRY_MAX_ATTEMPTS", "-5")
+	if got := retryConfigFromEnv().MaxAttempts; got < 1 {
+		t.Fatalf("MaxAttempts = %d, want >= 1", got)
+	}
+}
+
+// TestResilientClientNeverReturnsNilResponseWithNilError is a more direct
+// regression test for the same bug: even if a RetryConfig with
+// MaxAttempts <= 0 reaches doWithRetry some other way, Do must never
+// return (nil, nil), since callers unconditionally defer resp.Body.Close().
+func TestResilientClientNeverReturnsNilResponseWithNilError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	os.Unsetenv("DOWNSTREAM_BREAKER_FAILURE_THRESHOLD")
+	client := NewResilientClient("test-zero-attempts", server.Client())
+	client.retry.MaxAttempts = 0
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	resp, err := client.Do(req)
+	if err == nil {
+		t.Fatal("expected an error when MaxAttempts permits no attempts")
+	}
+	if resp != nil {
+		t.Fatalf("expected a nil response alongside the error, got %+v", resp)
+	}
+}
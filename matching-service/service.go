@@ -4,31 +4,38 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+
+	"github.com/CS3219-AY2526Sem1/cs3219-ay2526s1-project-g30/matching-service/metrics"
+	"github.com/CS3219-AY2526Sem1/cs3219-ay2526s1-project-g30/matching-service/repo"
 )
 
 type MatchingService struct {
-	mutex       sync.Mutex
-	waitingPool map[string][]*WaitingUser // CHANGED: value is now a slice of pointers
-	userIndex   map[string]*WaitingUser
-	matcher     Matcher
+	pool    WaitingPool
+	matcher Matcher
+	repo    repo.Repo
 }
 
-// NewMatchingService constructor is updated for the new waitingPool type.
-func NewMatchingService(matcher Matcher) *MatchingService {
+// NewMatchingService wires a matcher, a waiting pool and a history repo
+// together. The pool may be an in-memory map (single instance) or a
+// Redis-backed one shared across replicas, and the repo may be a no-op
+// (no DATABASE_URL configured) or Postgres-backed; MatchingService
+// doesn't need to know which.
+func NewMatchingService(matcher Matcher, pool WaitingPool, matchRepo repo.Repo) *MatchingService {
 	return &MatchingService{
-		waitingPool: make(map[string][]*WaitingUser),
-		userIndex:   make(map[string]*WaitingUser),
-		matcher:     matcher,
+		pool:    pool,
+		matcher: matcher,
+		repo:    matchRepo,
 	}
 }
 
@@ -39,7 +46,28 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-func getQuestionFromService(difficulty string, topic string, user1ID string, user2ID string) (string, error) {
+// questionClient and collabClient wrap the downstream calls with retry,
+// backoff and a circuit breaker so a sick dependency fails fast instead
+// of chewing up every match's 10s budget.
+var (
+	questionClient = NewResilientClient("question-service", &http.Client{Timeout: 10 * time.Second})
+	collabClient   = NewResilientClient("collaboration-service", &http.Client{Timeout: 10 * time.Second})
+)
+
+// observeDownstream records a downstream HTTP call's latency and, on
+// failure, counts it as an error, so the two Prometheus series stay
+// consistent with each other no matter which call site reports them.
+func observeDownstream(service string, start time.Time, err error) {
+	metrics.DownstreamDuration.WithLabelValues(service).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.DownstreamErrors.WithLabelValues(service).Inc()
+	}
+}
+
+func getQuestionFromService(difficulty string, topic string, user1ID string, user2ID string) (questionID string, err error) {
+	start := time.Now()
+	defer func() { observeDownstream("question", start, err) }()
+
 	baseURL := getEnv("QUESTION_SERVICE_URL", "http://localhost:8081")
 
 	parsedURL, err := url.Parse(baseURL)
@@ -67,8 +95,12 @@ func getQuestionFromService(difficulty string, topic string, user1ID string, use
 
 	log.Info().Str("url", finalURL).Msg("Requesting question from Question Service...")
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get(finalURL)
+	httpReq, err := http.NewRequest(http.MethodGet, finalURL, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create request for Question Service")
+		return "", err
+	}
+	resp, err := questionClient.Do(httpReq)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to send request to Question Service")
 		return "", err
@@ -88,7 +120,10 @@ func getQuestionFromService(difficulty string, topic string, user1ID string, use
 	return target.QuestionID, nil
 }
 
-func informCollaborationService(payload CollaborationRequest) error {
+func informCollaborationService(payload CollaborationRequest) (err error) {
+	start := time.Now()
+	defer func() { observeDownstream("collaboration", start, err) }()
+
 	baseURL := getEnv("COLLAB_SERVICE_URL", "http://localhost:8082")
 	// HACK: temply rm `v1` for collab compatibility
 	// url := fmt.Sprintf("%s/api/v1/sessions", baseURL)
@@ -105,8 +140,11 @@ func informCollaborationService(payload CollaborationRequest) error {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	// Derived from SessionID (unique per match) so a retried or duplicated
+	// call can't create two sessions for the same match.
+	req.Header.Set("Idempotency-Key", payload.SessionID)
+
+	resp, err := collabClient.Do(req)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to send request to Collaboration Service")
 		return err
@@ -120,127 +158,284 @@ func informCollaborationService(payload CollaborationRequest) error {
 }
 
 func (s *MatchingService) CancelMatchRequest(userID string) bool {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	ctx := context.Background()
 
-	user, found := s.userIndex[userID]
-	if !found {
+	user, err := s.pool.Remove(ctx, userID)
+	if err != nil {
+		log.Error().Err(err).Str("userId", userID).Msg("Failed to remove user from pool while cancelling.")
+		return false
+	}
+	if user == nil {
 		log.Warn().Str("userId", userID).Msg("User tried to cancel, but was not in the pool.")
 		return false
 	}
 
-	delete(s.userIndex, userID)
+	log.Info().Str("userId", userID).Msg("User successfully canceled and removed from pool.")
+	if err := s.pool.Notify(ctx, user, MatchResult{}); err != nil { // NOTE: will cause 408
+		log.Error().Err(err).Str("userId", userID).Msg("Failed to notify user of cancellation.")
+	}
+	if err := s.repo.RecordEvent(ctx, repo.Event{
+		UserID:     userID,
+		Difficulty: user.Info.Difficulty,
+		Topic:      user.Info.Topic,
+		Outcome:    "cancelled",
+		OccurredAt: time.Now(),
+		WaitMs:     time.Since(user.EnqueuedAt).Milliseconds(),
+	}); err != nil {
+		log.Error().Err(err).Str("userId", userID).Msg("Failed to record cancellation event.")
+	}
+	return true
+}
 
-	key := createMatchKey(user.Info.Difficulty, user.Info.Topic)
-	if users, found := s.waitingPool[key]; found {
-		for i, u := range users {
-			if u.Info.UserID == userID {
-				s.waitingPool[key][i] = s.waitingPool[key][len(users)-1]
-				s.waitingPool[key] = s.waitingPool[key][:len(users)-1]
+// matchCompletion is the outcome of completeMatch.
+type matchCompletion int
+
+const (
+	// matchCompleted: both users have a session and were notified.
+	matchCompleted matchCompletion = iota
+	// matchFailedHard: the question couldn't be fetched at all, so there's
+	// nothing to retry with; the opponent has been notified of the
+	// failure and the caller should report the same failure to its side.
+	matchFailedHard
+	// matchRequeued: a question was found but the Collaboration Service
+	// never confirmed the session. Rather than drop two already-matched
+	// users, the opponent has been put back in its bucket and the caller
+	// should do the same for its own side and keep waiting.
+	matchRequeued
+)
 
-				log.Info().Str("userId", userID).Str("key", key).Msg("User successfully canceled and removed from pool.")
+// completeMatch fetches a question and informs the Collaboration Service
+// for a pair that's just been matched.
+func (s *MatchingService) completeMatch(ctx context.Context, newUser *WaitingUser, opponent *WaitingUser, chosenLang string) (MatchResult, matchCompletion) {
+	req := newUser.Info
+	log.Info().Str("user1Id", req.UserID).Str("user2Id", opponent.Info.UserID).Str("language", chosenLang).Msg("Match found")
 
-				user.NotifyChan <- MatchResult{} // NOTE: will cause 408
-				return true
-			}
+	questionID, err := getQuestionFromService(req.Difficulty, req.Topic, req.UserID, opponent.Info.UserID)
+	if err != nil {
+		s.pool.Notify(ctx, opponent, MatchResult{Failed: true})
+		return MatchResult{}, matchFailedHard
+	}
+
+	sessionID := uuid.NewString()
+	collabPayload := CollaborationRequest{
+		User1ID:         req.UserID,
+		User2ID:         opponent.Info.UserID,
+		QuestionID:      questionID,
+		SessionID:       sessionID,
+		ProgrammingLang: chosenLang,
+	}
+	if err := informCollaborationService(collabPayload); err != nil {
+		log.Warn().Err(err).Str("sessionId", sessionID).Msg("Collaboration Service failed after a match was found; re-enqueuing both users instead of dropping them.")
+		opponentKey := createMatchKey(opponent.Info.Difficulty, opponent.Info.Topic)
+		if err := s.pool.Requeue(ctx, opponentKey, opponent); err != nil {
+			log.Error().Err(err).Str("userId", opponent.Info.UserID).Msg("Failed to re-enqueue opponent after a Collaboration Service failure.")
 		}
+		metrics.Requeues.WithLabelValues("collab_failure").Inc()
+		return MatchResult{}, matchRequeued
 	}
 
-	log.Error().Str("userId", userID).Msg("CRITICAL: User was in userIndex but not in waitingPool. State was inconsistent.")
-	return false
+	result := MatchResult{
+		SessionID:       sessionID,
+		QuestionID:      questionID,
+		User1ID:         req.UserID,
+		User2ID:         opponent.Info.UserID,
+		ProgrammingLang: chosenLang,
+	}
+	s.pool.Notify(ctx, opponent, result)
+
+	if err := s.repo.RecordMatch(ctx, repo.Match{
+		SessionID:       sessionID,
+		User1ID:         req.UserID,
+		User2ID:         opponent.Info.UserID,
+		QuestionID:      questionID,
+		Difficulty:      req.Difficulty,
+		Topic:           req.Topic,
+		ProgrammingLang: chosenLang,
+		MatchedAt:       time.Now(),
+		User1WaitMs:     time.Since(newUser.EnqueuedAt).Milliseconds(),
+		User2WaitMs:     time.Since(opponent.EnqueuedAt).Milliseconds(),
+	}); err != nil {
+		log.Error().Err(err).Str("sessionId", sessionID).Msg("Failed to record match history.")
+	}
+
+	return result, matchCompleted
+}
+
+// recordOutcome records how a match request was ultimately resolved and
+// how long it spent waiting. outcome is one of "matched", "timeout",
+// "cancelled" or "error".
+func recordOutcome(req MatchRequest, enqueuedAt time.Time, outcome string) {
+	metrics.MatchOutcomes.WithLabelValues(outcome).Inc()
+	metrics.WaitDuration.WithLabelValues(strings.ToLower(req.Difficulty), strings.ToLower(req.Topic)).Observe(time.Since(enqueuedAt).Seconds())
+}
+
+// queueUpdateInterval is how often a waiting request gets a queue_update
+// event with its current position and estimated match probability.
+const queueUpdateInterval = 3 * time.Second
+
+// estimateMatchProbability is a simple heuristic for how likely a still-
+// waiting request is to be matched before it times out: it decays from 1
+// towards 0 as elapsed approaches waitTimeout. It's meant to give a client
+// a rough sense of progress, not a statistically rigorous estimate.
+func estimateMatchProbability(elapsed time.Duration) float64 {
+	remaining := 1 - elapsed.Seconds()/waitTimeout.Seconds()
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
 }
 
-func (s *MatchingService) ProcessMatchRequest(req MatchRequest) chan MatchResult {
-	resultChan := make(chan MatchResult, 1)
+// ProcessMatchRequest searches for a match and, if none is immediately
+// available, enqueues req and streams MatchEvents until one of: a match is
+// found (by this request or another), the wait times out, or the request
+// is cancelled (see CancelMatchRequest). The returned channel is closed
+// after its terminal event.
+func (s *MatchingService) ProcessMatchRequest(req MatchRequest) <-chan MatchEvent {
+	events := make(chan MatchEvent, 4)
 
 	go func() {
+		defer close(events)
+		ctx := context.Background()
+
 		newUser := &WaitingUser{
 			Info:       req,
-			NotifyChan: resultChan,
+			NotifyChan: make(chan MatchResult, 1),
+			EnqueuedAt: time.Now(),
 		}
 
-		s.mutex.Lock()
-
 		key := createMatchKey(newUser.Info.Difficulty, newUser.Info.Topic)
 
-		if opponent, chosenLang := s.matcher.FindMatch(newUser, s.waitingPool); opponent != nil {
-			log.Info().Str("user1Id", newUser.Info.UserID).Str("user2Id", opponent.Info.UserID).Str("language", chosenLang).Msg("Match found")
-
-			// Remove the opponent from the waiting slice.
-			opponents := s.waitingPool[key]
-			for i, user := range opponents {
-				if user.Info.UserID == opponent.Info.UserID {
-					s.waitingPool[key] = append(opponents[:i], opponents[i+1:]...)
-					break
-				}
-			}
-			delete(s.userIndex, opponent.Info.UserID)
-			s.mutex.Unlock()
+		opponent, chosenLang, err := s.matcher.FindMatch(ctx, newUser, s.pool)
+		if err != nil {
+			log.Error().Err(err).Str("userId", req.UserID).Msg("Failed to search the waiting pool for a match.")
+			recordOutcome(req, newUser.EnqueuedAt, "error")
+			events <- MatchEvent{Type: EventError}
+			return
+		}
 
-			questionID, err := getQuestionFromService(req.Difficulty, req.Topic, req.UserID, opponent.Info.UserID)
-			if err != nil {
-				opponent.NotifyChan <- MatchResult{}
-				resultChan <- MatchResult{}
+		if opponent != nil {
+			result, status := s.completeMatch(ctx, newUser, opponent, chosenLang)
+			switch status {
+			case matchCompleted:
+				recordOutcome(req, newUser.EnqueuedAt, "matched")
+				events <- MatchEvent{Type: EventMatchFound, Result: &result}
 				return
-			}
-
-			sessionID := uuid.NewString()
-
-			collabPayload := CollaborationRequest{
-				User1ID:         req.UserID,
-				User2ID:         opponent.Info.UserID,
-				QuestionID:      questionID,
-				SessionID:       sessionID,
-				ProgrammingLang: chosenLang,
-			}
-			if err := informCollaborationService(collabPayload); err != nil {
-				opponent.NotifyChan <- MatchResult{}
-				resultChan <- MatchResult{}
+			case matchFailedHard:
+				recordOutcome(req, newUser.EnqueuedAt, "error")
+				events <- MatchEvent{Type: EventError}
+				return
+			case matchRequeued:
+				// completeMatch already put opponent back at the front of
+				// its bucket via Requeue; do the same for newUser instead
+				// of falling through to the Enqueue path below, which
+				// appends to the back and would leave one half of an
+				// already-matched pair behind every other waiter while
+				// its partner jumps the line.
+				log.Info().Str("userId", newUser.Info.UserID).Str("key", key).Msg("Re-enqueuing at the front of the bucket after a Collaboration Service failure.")
+				if err := s.pool.Requeue(ctx, key, newUser); err != nil {
+					log.Error().Err(err).Str("userId", req.UserID).Msg("Failed to re-enqueue user after a Collaboration Service failure.")
+					recordOutcome(req, newUser.EnqueuedAt, "error")
+					events <- MatchEvent{Type: EventError}
+					return
+				}
+				s.awaitMatch(ctx, req, newUser, key, events)
 				return
 			}
+		}
 
-			// Add the chosen language to the final result.
-			result := MatchResult{
-				SessionID:       sessionID,
-				QuestionID:      questionID,
-				User1ID:         req.UserID,
-				User2ID:         opponent.Info.UserID,
-				ProgrammingLang: chosenLang,
-			}
-
-			opponent.NotifyChan <- result
-			resultChan <- result
+		// If no match was found, add the current user to the waiting pool.
+		log.Info().Str("userId", newUser.Info.UserID).Str("key", key).Msg("User added to the waiting pool")
+		if err := s.pool.Enqueue(ctx, key, newUser); err != nil {
+			log.Error().Err(err).Str("userId", req.UserID).Msg("Failed to add user to the waiting pool.")
+			recordOutcome(req, newUser.EnqueuedAt, "error")
+			events <- MatchEvent{Type: EventError}
 			return
 		}
 
-		// If no match was found, add the current user to the waiting slice.
-		log.Info().Str("userId", newUser.Info.UserID).Str("key", key).Msg("User added to the waiting pool")
-		s.waitingPool[key] = append(s.waitingPool[key], newUser)
-		s.userIndex[newUser.Info.UserID] = newUser
-		s.mutex.Unlock()
+		s.awaitMatch(ctx, req, newUser, key, events)
+	}()
 
+	return events
+}
+
+// awaitMatch waits for newUser, already enqueued under key, to be matched,
+// time out, or be cancelled, emitting MatchEvents as it goes.
+func (s *MatchingService) awaitMatch(ctx context.Context, req MatchRequest, newUser *WaitingUser, key string, events chan<- MatchEvent) {
+	ticker := time.NewTicker(queueUpdateInterval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(waitTimeout)
+	defer deadline.Stop()
+	graceUsed := false
+
+	for {
 		select {
-		case <-resultChan:
-			log.Info().Str("userId", req.UserID).Msg("User was successfully matched by another user. Exiting wait.")
+		case result := <-newUser.NotifyChan:
+			if result.Failed {
+				log.Warn().Str("userId", req.UserID).Msg("Match request was abandoned after a failure elsewhere in the pool.")
+				recordOutcome(req, newUser.EnqueuedAt, "error")
+				events <- MatchEvent{Type: EventError}
+			} else if result.SessionID == "" {
+				log.Info().Str("userId", req.UserID).Msg("Match request was cancelled while waiting.")
+				recordOutcome(req, newUser.EnqueuedAt, "cancelled")
+				events <- MatchEvent{Type: EventCancelled}
+			} else {
+				log.Info().Str("userId", req.UserID).Msg("User was successfully matched by another user. Exiting wait.")
+				recordOutcome(req, newUser.EnqueuedAt, "matched")
+				events <- MatchEvent{Type: EventMatchFound, Result: &result}
+			}
 			return
-		case <-time.After(30 * time.Second):
-			s.mutex.Lock()
-			key_timeout := createMatchKey(req.Difficulty, req.Topic)
-
-			if users, found := s.waitingPool[key_timeout]; found {
-				for i, user := range users {
-					if user.Info.UserID == req.UserID {
-						s.waitingPool[key_timeout] = append(users[:i], users[i+1:]...)
-						delete(s.userIndex, req.UserID)
-						log.Info().Str("userId", req.UserID).Msg("User timed out and was removed from the pool.")
-						resultChan <- MatchResult{}
-						break
-					}
+
+		case <-ticker.C:
+			size, err := s.pool.Size(ctx, key)
+			if err != nil {
+				log.Error().Err(err).Str("userId", req.UserID).Msg("Failed to read queue size for a queue_update event.")
+				continue
+			}
+			metrics.PoolSize.WithLabelValues(strings.ToLower(req.Difficulty), strings.ToLower(req.Topic)).Set(float64(size))
+			elapsed := time.Since(newUser.EnqueuedAt)
+			events <- MatchEvent{
+				Type:             EventQueueUpdate,
+				Position:         size,
+				ElapsedSeconds:   elapsed.Seconds(),
+				MatchProbability: estimateMatchProbability(elapsed),
+			}
+
+		case <-deadline.C:
+			removed, err := s.pool.Remove(ctx, req.UserID)
+			if err != nil {
+				log.Error().Err(err).Str("userId", req.UserID).Msg("Failed to remove timed-out user from the pool.")
+				recordOutcome(req, newUser.EnqueuedAt, "error")
+				events <- MatchEvent{Type: EventError}
+				return
+			}
+			if removed == nil && !graceUsed {
+				// Another request's search already popped newUser and its
+				// result is still on the way over NotifyChan; wait one more
+				// waitTimeout for it before giving up.
+				graceUsed = true
+				deadline.Reset(waitTimeout)
+				continue
+			}
+			if removed == nil {
+				log.Warn().Str("userId", req.UserID).Msg("User was popped from the pool but no result arrived; reporting a timeout.")
+				recordOutcome(req, newUser.EnqueuedAt, "timeout")
+				events <- MatchEvent{Type: EventTimeout}
+			} else {
+				log.Info().Str("userId", req.UserID).Msg("User timed out and was removed from the pool.")
+				recordOutcome(req, newUser.EnqueuedAt, "timeout")
+				if err := s.repo.RecordEvent(ctx, repo.Event{
+					UserID:     req.UserID,
+					Difficulty: req.Difficulty,
+					Topic:      req.Topic,
+					Outcome:    "timeout",
+					OccurredAt: time.Now(),
+					WaitMs:     time.Since(newUser.EnqueuedAt).Milliseconds(),
+				}); err != nil {
+					log.Error().Err(err).Str("userId", req.UserID).Msg("Failed to record timeout event.")
 				}
+				events <- MatchEvent{Type: EventTimeout}
 			}
-			s.mutex.Unlock()
+			return
 		}
-	}()
-
-	return resultChan
+	}
 }
@@ -1,6 +1,8 @@
 // tyoes.go
 package main
 
+import "time"
+
 type MatchRequest struct {
 	UserID                   string   `json:"userId"`
 	Difficulty               string   `json:"difficulty"`
@@ -14,11 +16,19 @@ type MatchResult struct {
 	User1ID         string `json:"user1Id"`
 	User2ID         string `json:"user2Id"`
 	ProgrammingLang string `json:"programmingLang"`
+
+	// Failed marks a NotifyChan/Notify delivery that isn't a real match or
+	// cancellation but tells a stranded waiter to give up with an error
+	// rather than sit out its full timeout. It is encoded (when true) so it
+	// survives RedisWaitingPool's Pub/Sub relay; a result with Failed set
+	// is never sent to a client.
+	Failed bool `json:"failed,omitempty"`
 }
 
 type WaitingUser struct {
 	Info       MatchRequest
 	NotifyChan chan MatchResult
+	EnqueuedAt time.Time
 }
 
 // HACK: temply change `questionId` to `id` for ques compatibility
@@ -40,3 +50,26 @@ type CollaborationRequest struct {
 type CancelRequest struct {
 	UserID string `json:"userId"`
 }
+
+// MatchEventType distinguishes the frames streamed over the WebSocket
+// matchmaking channel.
+type MatchEventType string
+
+const (
+	EventQueueUpdate MatchEventType = "queue_update"
+	EventMatchFound  MatchEventType = "match_found"
+	EventTimeout     MatchEventType = "timeout"
+	EventCancelled   MatchEventType = "cancelled"
+	EventError       MatchEventType = "error"
+)
+
+// MatchEvent is one frame of the stream ProcessMatchRequest emits: zero or
+// more queue_update frames followed by exactly one terminal frame
+// (match_found, timeout, cancelled or error).
+type MatchEvent struct {
+	Type             MatchEventType `json:"type"`
+	Result           *MatchResult   `json:"result,omitempty"`
+	Position         int            `json:"position,omitempty"`
+	ElapsedSeconds   float64        `json:"elapsedSeconds,omitempty"`
+	MatchProbability float64        `json:"matchProbability,omitempty"`
+}
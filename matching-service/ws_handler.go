@@ -0,0 +1,75 @@
+// ws_handler.go
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+var matchWSUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// The frontend is served from a different origin in dev; tighten this
+	// to an allowlist before this reaches production.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsControlFrame is the only frame type a client sends after its initial
+// MatchRequest: a cancel request. Connection loss is treated the same way.
+type wsControlFrame struct {
+	Type string `json:"type"`
+}
+
+// createMatchWSHandler upgrades to a WebSocket, reads the client's
+// MatchRequest frame, then streams MatchEvent frames (queue_update
+// updates followed by a terminal match_found/timeout/cancelled/error)
+// until the request resolves. A `{"type":"cancel"}` frame, or the
+// connection dropping, cancels the request through CancelMatchRequest,
+// the same call createCancelHandler makes.
+func createMatchWSHandler(service *MatchingService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conn, err := matchWSUpgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to upgrade match request to a WebSocket")
+			return
+		}
+		defer conn.Close()
+
+		var req MatchRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			log.Warn().Err(err).Msg("Failed to read MatchRequest frame over WebSocket")
+			return
+		}
+
+		events := service.ProcessMatchRequest(req)
+
+		// Any read error (explicit cancel frame, or the client going away)
+		// cancels the request; CancelMatchRequest is a no-op if it has
+		// already resolved.
+		go func() {
+			for {
+				var frame wsControlFrame
+				if err := conn.ReadJSON(&frame); err != nil {
+					service.CancelMatchRequest(req.UserID)
+					return
+				}
+				if frame.Type == "cancel" {
+					service.CancelMatchRequest(req.UserID)
+					return
+				}
+			}
+		}()
+
+		for event := range events {
+			if err := conn.WriteJSON(event); err != nil {
+				log.Warn().Err(err).Str("userId", req.UserID).Msg("Failed to write match event, client likely disconnected")
+				service.CancelMatchRequest(req.UserID)
+				return
+			}
+		}
+	}
+}